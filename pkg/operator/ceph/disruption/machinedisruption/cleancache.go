@@ -0,0 +1,98 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinedisruption
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// clusterCleanCache remembers the last IsClusterClean result per CephCluster, invalidated
+// by the watches in controller.go rather than expired on a timer.
+type clusterCleanCache struct {
+	mu      sync.Mutex
+	entries map[types.NamespacedName]bool
+}
+
+func newClusterCleanCache() *clusterCleanCache {
+	return &clusterCleanCache{entries: map[types.NamespacedName]bool{}}
+}
+
+// Get returns the cached cleanliness for the cluster and whether it was present.
+func (c *clusterCleanCache) Get(key types.NamespacedName) (isClean bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	isClean, ok = c.entries[key]
+	return isClean, ok
+}
+
+// Set records the cleanliness just observed for the cluster.
+func (c *clusterCleanCache) Set(key types.NamespacedName, isClean bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = isClean
+}
+
+// Invalidate drops any cached value for the cluster, forcing the next reconcile to query
+// ceph directly.
+func (c *clusterCleanCache) Invalidate(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// poolReplication is the subset of a pool's replication parameters reconcileDomainMDB needs
+// to size a failure domain's budget.
+type poolReplication struct {
+	Size    int
+	MinSize int
+}
+
+// poolReplicationCache remembers the last GetPoolReplication result per CephCluster, the
+// same way clusterCleanCache does for IsClusterClean.
+type poolReplicationCache struct {
+	mu      sync.Mutex
+	entries map[types.NamespacedName]poolReplication
+}
+
+func newPoolReplicationCache() *poolReplicationCache {
+	return &poolReplicationCache{entries: map[types.NamespacedName]poolReplication{}}
+}
+
+// Get returns the cached replication for the cluster and whether it was present.
+func (c *poolReplicationCache) Get(key types.NamespacedName) (replication poolReplication, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	replication, ok = c.entries[key]
+	return replication, ok
+}
+
+// Set records the replication just observed for the cluster.
+func (c *poolReplicationCache) Set(key types.NamespacedName, replication poolReplication) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = replication
+}
+
+// Invalidate drops any cached value for the cluster, forcing the next reconcile to query
+// ceph directly.
+func (c *poolReplicationCache) Invalidate(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
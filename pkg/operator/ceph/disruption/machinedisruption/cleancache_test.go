@@ -0,0 +1,62 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinedisruption
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestClusterCleanCache(t *testing.T) {
+	key := types.NamespacedName{Name: "my-cluster", Namespace: "rook-ceph"}
+	c := newClusterCleanCache()
+
+	if _, ok := c.Get(key); ok {
+		t.Fatal("expected a miss on an empty cache")
+	}
+
+	c.Set(key, true)
+	if isClean, ok := c.Get(key); !ok || !isClean {
+		t.Fatalf("Get(%v) = %v, %v; want true, true", key, isClean, ok)
+	}
+
+	c.Invalidate(key)
+	if _, ok := c.Get(key); ok {
+		t.Fatal("expected a miss after invalidating")
+	}
+}
+
+func TestPoolReplicationCache(t *testing.T) {
+	key := types.NamespacedName{Name: "my-cluster", Namespace: "rook-ceph"}
+	c := newPoolReplicationCache()
+
+	if _, ok := c.Get(key); ok {
+		t.Fatal("expected a miss on an empty cache")
+	}
+
+	want := poolReplication{Size: 3, MinSize: 2}
+	c.Set(key, want)
+	if got, ok := c.Get(key); !ok || got != want {
+		t.Fatalf("Get(%v) = %v, %v; want %v, true", key, got, ok, want)
+	}
+
+	c.Invalidate(key)
+	if _, ok := c.Get(key); ok {
+		t.Fatal("expected a miss after invalidating")
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinedisruption
+
+import (
+	"reflect"
+	"time"
+
+	healthchecking "github.com/openshift/machine-api-operator/pkg/apis/healthchecking/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/rook/rook/pkg/operator/ceph/disruption/controllerconfig"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+)
+
+// Add registers the MachineDisruptionReconciler with the manager and its watches.
+func Add(mgr manager.Manager, context *controllerconfig.Context) error {
+	r := &MachineDisruptionReconciler{
+		client:               mgr.GetClient(),
+		scheme:               mgr.GetScheme(),
+		context:              context,
+		cleanCache:           newClusterCleanCache(),
+		poolReplicationCache: newPoolReplicationCache(),
+	}
+
+	c, err := controller.New(controllerName, mgr, controller.Options{
+		Reconciler: r,
+		// Back off a cluster whose reconciles keep failing, from one second up to five minutes.
+		RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(time.Second, 5*time.Minute),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := c.Watch(&source.Kind{Type: &cephv1.CephCluster{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.requestAndInvalidateForCluster),
+	}, predicate.Funcs{
+		UpdateFunc: deletionOrStatusChange,
+	}); err != nil {
+		return err
+	}
+
+	if err := c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.requestAndInvalidateForOSDLabels),
+	}, predicate.Funcs{UpdateFunc: osdReadinessChanged}); err != nil {
+		return err
+	}
+
+	if err := c.Watch(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.requestAndInvalidateForOSDLabels),
+	}, predicate.Funcs{UpdateFunc: osdReadinessChanged}); err != nil {
+		return err
+	}
+
+	if err := c.Watch(&source.Kind{Type: &healthchecking.MachineDisruptionBudget{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(requestForMDBLabels),
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// requestAndInvalidateForCluster enqueues a CephCluster itself, invalidating the cached
+// IsClusterClean and pool replication results for it.
+func (r *MachineDisruptionReconciler) requestAndInvalidateForCluster(obj handler.MapObject) []reconcile.Request {
+	key := types.NamespacedName{Name: obj.Meta.GetName(), Namespace: obj.Meta.GetNamespace()}
+	r.cleanCache.Invalidate(key)
+	r.poolReplicationCache.Invalidate(key)
+	return []reconcile.Request{{NamespacedName: key}}
+}
+
+// requestAndInvalidateForOSDLabels maps an OSD pod or deployment back to its owning
+// CephCluster via rook's usual `rook_cluster`/`app=rook-ceph-osd` labeling, invalidating
+// the cached IsClusterClean and pool replication results for that cluster.
+func (r *MachineDisruptionReconciler) requestAndInvalidateForOSDLabels(obj handler.MapObject) []reconcile.Request {
+	labels := obj.Meta.GetLabels()
+	if labels[k8sutil.AppAttr] != "rook-ceph-osd" {
+		return nil
+	}
+	clusterName, ok := labels[k8sutil.ClusterAttr]
+	if !ok {
+		return nil
+	}
+	key := types.NamespacedName{Name: clusterName, Namespace: obj.Meta.GetNamespace()}
+	r.cleanCache.Invalidate(key)
+	r.poolReplicationCache.Invalidate(key)
+	return []reconcile.Request{{NamespacedName: key}}
+}
+
+// requestForMDBLabels maps an MDB change back to the CephCluster that owns it using the
+// labels the reconciler itself stamps every MDB with.
+func requestForMDBLabels(obj handler.MapObject) []reconcile.Request {
+	labels := obj.Meta.GetLabels()
+	name, ok := labels[MDBCephClusterNameLabelKey]
+	if !ok {
+		return nil
+	}
+	namespace, ok := labels[MDBCephClusterNamespaceLabelKey]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}}}
+}
+
+// osdReadinessChanged restricts the OSD pod/deployment watches to readiness transitions,
+// ignoring status churn that doesn't affect whether OSDs are up.
+func osdReadinessChanged(e event.UpdateEvent) bool {
+	switch oldObj := e.ObjectOld.(type) {
+	case *corev1.Pod:
+		newObj, ok := e.ObjectNew.(*corev1.Pod)
+		if !ok {
+			return true
+		}
+		return podReadyCondition(oldObj) != podReadyCondition(newObj)
+	case *appsv1.Deployment:
+		newObj, ok := e.ObjectNew.(*appsv1.Deployment)
+		if !ok {
+			return true
+		}
+		return oldObj.Status.ReadyReplicas != newObj.Status.ReadyReplicas
+	default:
+		return true
+	}
+}
+
+func podReadyCondition(pod *corev1.Pod) corev1.ConditionStatus {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status
+		}
+	}
+	return corev1.ConditionUnknown
+}
+
+// deletionOrStatusChange restricts CephCluster update events to status subresource
+// changes; delete events pass through predicate.Funcs' default. Spec-only edits (e.g. a
+// user tweaking unrelated fields) don't affect disruption state and shouldn't trigger a
+// reconcile plus a ceph RPC.
+func deletionOrStatusChange(e event.UpdateEvent) bool {
+	oldCluster, ok := e.ObjectOld.(*cephv1.CephCluster)
+	if !ok {
+		return true
+	}
+	newCluster, ok := e.ObjectNew.(*cephv1.CephCluster)
+	if !ok {
+		return true
+	}
+	return !reflect.DeepEqual(oldCluster.Status, newCluster.Status)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinedisruption
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func podWithReady(status corev1.ConditionStatus) *corev1.Pod {
+	return &corev1.Pod{
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: status},
+			},
+		},
+	}
+}
+
+func TestOsdReadinessChanged(t *testing.T) {
+	if osdReadinessChanged(event.UpdateEvent{
+		ObjectOld: podWithReady(corev1.ConditionTrue),
+		ObjectNew: podWithReady(corev1.ConditionTrue),
+	}) {
+		t.Error("expected no change when pod readiness is unchanged")
+	}
+	if !osdReadinessChanged(event.UpdateEvent{
+		ObjectOld: podWithReady(corev1.ConditionFalse),
+		ObjectNew: podWithReady(corev1.ConditionTrue),
+	}) {
+		t.Error("expected a change when pod readiness transitions")
+	}
+
+	oldDeploy := &appsv1.Deployment{Status: appsv1.DeploymentStatus{ReadyReplicas: 3}}
+	newDeploy := &appsv1.Deployment{Status: appsv1.DeploymentStatus{ReadyReplicas: 3}}
+	if osdReadinessChanged(event.UpdateEvent{ObjectOld: oldDeploy, ObjectNew: newDeploy}) {
+		t.Error("expected no change when deployment ReadyReplicas is unchanged")
+	}
+	newDeploy = &appsv1.Deployment{Status: appsv1.DeploymentStatus{ReadyReplicas: 2}}
+	if !osdReadinessChanged(event.UpdateEvent{ObjectOld: oldDeploy, ObjectNew: newDeploy}) {
+		t.Error("expected a change when deployment ReadyReplicas drops")
+	}
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinedisruption
+
+import (
+	"context"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	healthchecking "github.com/openshift/machine-api-operator/pkg/apis/healthchecking/v1alpha1"
+	machineapi "github.com/openshift/machine-api-operator/pkg/apis/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	cephClient "github.com/rook/rook/pkg/daemon/ceph/client"
+	cephCluster "github.com/rook/rook/pkg/operator/ceph/cluster"
+	"github.com/rook/rook/pkg/operator/ceph/disruption/controllerconfig"
+	"github.com/rook/rook/pkg/operator/ceph/disruption/machinelabel"
+)
+
+const (
+	healthCheckControllerName = "machinehealthcheck-controller"
+
+	// machineUnhealthySinceCondition is the MAO node condition MHC watches to decide a
+	// Machine needs remediation; rook reacts to the same condition to start draining
+	// early rather than waiting for MAO's own remediation timers.
+	machineUnhealthySinceCondition = corev1.NodeReady
+)
+
+var healthCheckLogger = capnslog.NewPackageLogger("github.com/rook/rook", healthCheckControllerName)
+
+// MachineHealthCheckReconciler creates and owns a MachineHealthCheck selecting the same
+// fenced Machines as the MachineDisruptionReconciler's MDBs, and reacts to Machines MAO
+// has marked unhealthy by pre-emptively evacuating their OSDs instead of waiting for MAO
+// to delete the Machine.
+type MachineHealthCheckReconciler struct {
+	scheme  *runtime.Scheme
+	client  client.Client
+	context *controllerconfig.Context
+}
+
+// Reconcile ensures the MachineHealthCheck for a CephCluster matches its
+// DisruptionManagement spec, then remediates any Machine the MHC has found unhealthy.
+func (r *MachineHealthCheckReconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	healthCheckLogger.Debugf("reconciling %s", request.NamespacedName)
+
+	cephClusterInstance := &cephv1.CephCluster{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, cephClusterInstance)
+	if errors.IsNotFound(err) {
+		return reconcile.Result{}, nil
+	} else if err != nil {
+		healthCheckLogger.Errorf("could not fetch cephCluster %s: %+v", request.Name, err)
+		return reconcile.Result{}, err
+	}
+
+	if !cephClusterInstance.Spec.DisruptionManagement.ManageMachineDisruptionBudgets {
+		return reconcile.Result{}, nil
+	}
+
+	unhealthyConditions, err := r.reconcileMachineHealthCheck(cephClusterInstance, request)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if err := r.remediateUnhealthyMachines(cephClusterInstance, request, unhealthyConditions); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// reconcileMachineHealthCheck ensures the MachineHealthCheck for a CephCluster matches its
+// DisruptionManagement spec, and returns the UnhealthyConditions it resolved the MHC to.
+func (r *MachineHealthCheckReconciler) reconcileMachineHealthCheck(cephClusterInstance *cephv1.CephCluster, request reconcile.Request) ([]healthchecking.UnhealthyCondition, error) {
+	name := generateMDBInstanceName(request.Name, request.Namespace)
+	mhc := &healthchecking.MachineHealthCheck{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cephClusterInstance.Spec.DisruptionManagement.MachineDisruptionBudgetNamespace,
+		},
+	}
+
+	maxUnhealthy := cephClusterInstance.Spec.DisruptionManagement.MachineHealthCheckMaxUnhealthy
+	if maxUnhealthy == "" {
+		maxUnhealthy = "100%"
+	}
+	unhealthyConditions := cephClusterInstance.Spec.DisruptionManagement.MachineHealthCheckUnhealthyConditions
+	if len(unhealthyConditions) == 0 {
+		unhealthyConditions = defaultUnhealthyConditions()
+	}
+
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: mhc.GetName(), Namespace: mhc.GetNamespace()}, mhc)
+	if errors.IsNotFound(err) {
+		newMHC := &healthchecking.MachineHealthCheck{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: cephClusterInstance.Spec.DisruptionManagement.MachineDisruptionBudgetNamespace,
+				Labels: map[string]string{
+					MDBCephClusterNamespaceLabelKey: request.Namespace,
+					MDBCephClusterNameLabelKey:      request.Name,
+				},
+				OwnerReferences: []metav1.OwnerReference{cephCluster.ClusterOwnerRef(cephClusterInstance.GetName(), string(cephClusterInstance.GetUID()))},
+			},
+			Spec: healthchecking.MachineHealthCheckSpec{
+				Selector: metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						machinelabel.MachineFencingLabelKey:          request.Name,
+						machinelabel.MachineFencingNamespaceLabelKey: request.Namespace,
+					},
+				},
+				UnhealthyConditions: unhealthyConditions,
+				MaxUnhealthy:        &maxUnhealthy,
+			},
+		}
+		if err := r.client.Create(context.TODO(), newMHC); err != nil {
+			healthCheckLogger.Errorf("failed to create mhc %s: %+v", name, err)
+			return nil, err
+		}
+		return unhealthyConditions, nil
+	} else if err != nil {
+		healthCheckLogger.Errorf("%+v", err)
+		return nil, err
+	}
+
+	mhc.Spec.UnhealthyConditions = unhealthyConditions
+	mhc.Spec.MaxUnhealthy = &maxUnhealthy
+	if err := r.client.Update(context.TODO(), mhc); err != nil {
+		healthCheckLogger.Errorf("failed to update mhc %s: %+v", name, err)
+		return nil, err
+	}
+	return unhealthyConditions, nil
+}
+
+// remediateUnhealthyMachines cordons the node and marks its OSDs out for every fenced
+// Machine whose backing Node matches one of unhealthyConditions for at least that
+// condition's Timeout.
+func (r *MachineHealthCheckReconciler) remediateUnhealthyMachines(cephClusterInstance *cephv1.CephCluster, request reconcile.Request, unhealthyConditions []healthchecking.UnhealthyCondition) error {
+	machines := &machineapi.MachineList{}
+	err := r.client.List(context.TODO(), machines, client.MatchingLabels{
+		machinelabel.MachineFencingLabelKey:          request.Name,
+		machinelabel.MachineFencingNamespaceLabelKey: request.Namespace,
+	})
+	if err != nil {
+		healthCheckLogger.Errorf("failed to list fenced machines for %s: %+v", request.NamespacedName, err)
+		return err
+	}
+
+	for _, machine := range machines.Items {
+		if machine.Status.NodeRef == nil {
+			continue
+		}
+		nodeName := machine.Status.NodeRef.Name
+
+		node := &corev1.Node{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: nodeName}, node); err != nil {
+			healthCheckLogger.Errorf("failed to get node %s for unhealthy machine %s: %+v", nodeName, machine.Name, err)
+			continue
+		}
+		if !nodeMatchesUnhealthyConditions(node, unhealthyConditions, time.Now()) {
+			continue
+		}
+
+		if !node.Spec.Unschedulable {
+			node.Spec.Unschedulable = true
+			if err := r.client.Update(context.TODO(), node); err != nil {
+				healthCheckLogger.Errorf("failed to cordon node %s: %+v", nodeName, err)
+				continue
+			}
+		}
+
+		osdIDs, err := cephClient.GetOSDsOnNode(r.context.ClusterdContext, request.Name, nodeName)
+		if err != nil {
+			healthCheckLogger.Errorf("failed to list osds on node %s: %+v", nodeName, err)
+			continue
+		}
+		for _, osdID := range osdIDs {
+			if err := cephClient.OSDOut(r.context.ClusterdContext, request.Name, osdID); err != nil {
+				healthCheckLogger.Errorf("failed to mark osd.%d out on unhealthy node %s: %+v", osdID, nodeName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// nodeMatchesUnhealthyConditions reports whether node has been sitting in one of the
+// configured UnhealthyConditions for at least that condition's Timeout. now is passed in
+// so it's unit-testable against a fixed clock.
+func nodeMatchesUnhealthyConditions(node *corev1.Node, unhealthyConditions []healthchecking.UnhealthyCondition, now time.Time) bool {
+	for _, uc := range unhealthyConditions {
+		for _, cond := range node.Status.Conditions {
+			if cond.Type != uc.Type || cond.Status != uc.Status {
+				continue
+			}
+			if now.Sub(cond.LastTransitionTime.Time) >= uc.Timeout.Duration {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func defaultUnhealthyConditions() []healthchecking.UnhealthyCondition {
+	return []healthchecking.UnhealthyCondition{
+		{
+			Type:    machineUnhealthySinceCondition,
+			Status:  corev1.ConditionFalse,
+			Timeout: metav1.Duration{Duration: defaultUnhealthyTimeout},
+		},
+	}
+}
+
+// AddHealthCheckController registers the MachineHealthCheckReconciler with the manager and
+// its watches.
+func AddHealthCheckController(mgr manager.Manager, context *controllerconfig.Context) error {
+	r := &MachineHealthCheckReconciler{
+		client:  mgr.GetClient(),
+		scheme:  mgr.GetScheme(),
+		context: context,
+	}
+
+	c, err := controller.New(healthCheckControllerName, mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	if err := c.Watch(&source.Kind{Type: &cephv1.CephCluster{}}, &handler.EnqueueRequestForObject{}); err != nil {
+		return err
+	}
+
+	if err := c.Watch(&source.Kind{Type: &corev1.Node{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.requestForFencedMachineNode),
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// requestForFencedMachineNode maps a Node back to the CephCluster whose Machine it backs,
+// via the fencing labels machinelabel stamps onto that Machine.
+func (r *MachineHealthCheckReconciler) requestForFencedMachineNode(obj handler.MapObject) []reconcile.Request {
+	node, ok := obj.Object.(*corev1.Node)
+	if !ok {
+		return nil
+	}
+
+	machines := &machineapi.MachineList{}
+	if err := r.client.List(context.TODO(), machines); err != nil {
+		healthCheckLogger.Errorf("failed to list machines for node %s: %+v", node.GetName(), err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, machine := range machines.Items {
+		if machine.Status.NodeRef == nil || machine.Status.NodeRef.Name != node.GetName() {
+			continue
+		}
+		clusterName, ok := machine.Labels[machinelabel.MachineFencingLabelKey]
+		if !ok {
+			continue
+		}
+		clusterNamespace, ok := machine.Labels[machinelabel.MachineFencingNamespaceLabelKey]
+		if !ok {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: clusterName, Namespace: clusterNamespace}})
+	}
+	return requests
+}
+
+// defaultUnhealthyTimeout mirrors MAO's own default node-unhealthy timeout.
+const defaultUnhealthyTimeout = 5 * time.Minute
@@ -0,0 +1,69 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinedisruption
+
+import (
+	"testing"
+	"time"
+
+	healthchecking "github.com/openshift/machine-api-operator/pkg/apis/healthchecking/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeMatchesUnhealthyConditions(t *testing.T) {
+	now := time.Now()
+	conditions := []healthchecking.UnhealthyCondition{
+		{
+			Type:    corev1.NodeReady,
+			Status:  corev1.ConditionFalse,
+			Timeout: metav1.Duration{Duration: 5 * time.Minute},
+		},
+	}
+
+	node := func(transitionedAgo time.Duration) *corev1.Node {
+		return &corev1.Node{
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{
+					{
+						Type:               corev1.NodeReady,
+						Status:             corev1.ConditionFalse,
+						LastTransitionTime: metav1.NewTime(now.Add(-transitionedAgo)),
+					},
+				},
+			},
+		}
+	}
+
+	if nodeMatchesUnhealthyConditions(node(time.Minute), conditions, now) {
+		t.Error("expected a node that just went unready to not yet be unhealthy")
+	}
+	if !nodeMatchesUnhealthyConditions(node(10*time.Minute), conditions, now) {
+		t.Error("expected a node unready past the configured timeout to be unhealthy")
+	}
+
+	healthyNode := &corev1.Node{
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(now.Add(-time.Hour))},
+			},
+		},
+	}
+	if nodeMatchesUnhealthyConditions(healthyNode, conditions, now) {
+		t.Error("expected a ready node to never match an unhealthy condition")
+	}
+}
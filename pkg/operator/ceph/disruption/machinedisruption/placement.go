@@ -0,0 +1,221 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinedisruption
+
+import (
+	"context"
+	"fmt"
+
+	healthchecking "github.com/openshift/machine-api-operator/pkg/apis/healthchecking/v1alpha1"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
+	workv1 "open-cluster-management.io/api/work/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	cephCluster "github.com/rook/rook/pkg/operator/ceph/cluster"
+	"github.com/rook/rook/pkg/operator/ceph/disruption/machinelabel"
+)
+
+const (
+	// placementDecisionLabelKey is the well-known OCM label a PlacementDecision carries
+	// naming the Placement it resolves.
+	placementDecisionLabelKey = "cluster.open-cluster-management.io/placement"
+
+	// spokeMaxUnavailableFeedback is the name of the ManifestWork status feedback rule
+	// rook uses to read the spoke-materialized MDB's MaxUnavailable back to the hub,
+	// without the hub needing its own credentials into the spoke cluster.
+	spokeMaxUnavailableFeedback = "maxUnavailable"
+)
+
+// reconcilePlacementMDB handles stretch-mode CephClusters whose OSDs live on Machines
+// spread across multiple OCM-managed clusters. It returns handled=false when the
+// CephCluster doesn't set a PlacementRef, so the caller falls through to the single- or
+// sharded-cluster codepaths that cover every other deployment.
+func (r *MachineDisruptionReconciler) reconcilePlacementMDB(cephClusterInstance *cephv1.CephCluster, request reconcile.Request) (handled bool, err error) {
+	placementRef := cephClusterInstance.Spec.DisruptionManagement.PlacementRef
+	if placementRef == nil {
+		return false, nil
+	}
+
+	memberClusters, err := r.resolvePlacementDecision(placementRef.Name, request.Namespace)
+	if err != nil {
+		return true, err
+	}
+
+	isClean := true
+	for _, memberCluster := range memberClusters {
+		mw, err := r.reconcileSpokeManifestWork(cephClusterInstance, request, memberCluster)
+		if err != nil {
+			logger.Errorf("failed to reconcile manifestwork for member cluster %s: %+v", memberCluster, err)
+			return true, err
+		}
+		if !spokeIsClean(mw) {
+			isClean = false
+		}
+	}
+
+	name := generateMDBInstanceName(request.Name, request.Namespace)
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			machinelabel.MachineFencingLabelKey:          request.Name,
+			machinelabel.MachineFencingNamespaceLabelKey: request.Namespace,
+		},
+	}
+	return true, r.reconcileMDB(cephClusterInstance, request, name, selector, clusterWideMaxUnavailable(isClean))
+}
+
+// resolvePlacementDecision reads the PlacementDecisions produced by OCM for the named
+// Placement and returns the member cluster names it selected.
+func (r *MachineDisruptionReconciler) resolvePlacementDecision(placementName, namespace string) ([]string, error) {
+	decisions := &clusterv1beta1.PlacementDecisionList{}
+	err := r.client.List(context.TODO(), decisions, client.InNamespace(namespace), client.MatchingLabels{
+		placementDecisionLabelKey: placementName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list placement decisions for placement %s: %+v", placementName, err)
+	}
+
+	var clusters []string
+	for _, decision := range decisions.Items {
+		for _, d := range decision.Status.Decisions {
+			clusters = append(clusters, d.ClusterName)
+		}
+	}
+	return clusters, nil
+}
+
+// reconcileSpokeManifestWork creates or updates the ManifestWork that materializes an MDB
+// on the given member cluster. MaxUnavailable is seeded at 0; the ManifestConfigOption's
+// apply strategy ignores that field after creation, leaving the spoke's own reconciler to
+// own the real value, and a status feedback rule mirrors it back onto the ManifestWork.
+func (r *MachineDisruptionReconciler) reconcileSpokeManifestWork(cephClusterInstance *cephv1.CephCluster, request reconcile.Request, memberCluster string) (*workv1.ManifestWork, error) {
+	name := fmt.Sprintf("%s-mdb", generateMDBInstanceName(request.Name, request.Namespace))
+	mdbNamespace := cephClusterInstance.Spec.DisruptionManagement.MachineDisruptionBudgetNamespace
+	maxUnavailable := int32(0)
+
+	manifest := &healthchecking.MachineDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generateMDBInstanceName(request.Name, request.Namespace),
+			Namespace: mdbNamespace,
+			Labels: map[string]string{
+				MDBCephClusterNamespaceLabelKey: request.Namespace,
+				MDBCephClusterNameLabelKey:      request.Name,
+			},
+		},
+		Spec: healthchecking.MachineDisruptionBudgetSpec{
+			MaxUnavailable: &maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					machinelabel.MachineFencingLabelKey:          request.Name,
+					machinelabel.MachineFencingNamespaceLabelKey: request.Namespace,
+				},
+			},
+		},
+	}
+
+	mw := &workv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: memberCluster},
+	}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: memberCluster}, mw)
+	if errors.IsNotFound(err) {
+		newMW := &workv1.ManifestWork{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: memberCluster,
+				Labels: map[string]string{
+					MDBCephClusterNamespaceLabelKey: request.Namespace,
+					MDBCephClusterNameLabelKey:      request.Name,
+				},
+				OwnerReferences: []metav1.OwnerReference{cephCluster.ClusterOwnerRef(cephClusterInstance.GetName(), string(cephClusterInstance.GetUID()))},
+			},
+			Spec: workv1.ManifestWorkSpec{
+				Workload: workv1.ManifestsTemplate{
+					Manifests: []workv1.Manifest{{RawExtension: runtime.RawExtension{Object: manifest}}},
+				},
+				ManifestConfigs: []workv1.ManifestConfigOption{
+					{
+						ResourceIdentifier: workv1.ResourceIdentifier{
+							Group:     healthchecking.SchemeGroupVersion.Group,
+							Resource:  "machinedisruptionbudgets",
+							Name:      manifest.Name,
+							Namespace: manifest.Namespace,
+						},
+						FeedbackRules: []workv1.FeedbackRule{
+							{
+								Type: workv1.JSONPathsType,
+								JsonPaths: []workv1.JsonPath{
+									{Name: spokeMaxUnavailableFeedback, Path: ".spec.maxUnavailable"},
+								},
+							},
+						},
+						UpdateStrategy: &workv1.UpdateStrategy{
+							Type: workv1.UpdateStrategyTypeServerSideApply,
+							ServerSideApply: &workv1.ServerSideApplyConfig{
+								IgnoreFields: []workv1.IgnoreField{
+									{
+										Condition: workv1.IgnoreFieldsConditionOnSpokePresent,
+										JSONPaths: []string{".spec.maxUnavailable"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		if err := r.client.Create(context.TODO(), newMW); err != nil {
+			return nil, fmt.Errorf("failed to create manifestwork %s/%s: %+v", memberCluster, name, err)
+		}
+		return newMW, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get manifestwork %s/%s: %+v", memberCluster, name, err)
+	}
+
+	mw.Spec.Workload.Manifests = []workv1.Manifest{{RawExtension: runtime.RawExtension{Object: manifest}}}
+	if err := r.client.Update(context.TODO(), mw); err != nil {
+		return nil, fmt.Errorf("failed to update manifestwork %s/%s: %+v", memberCluster, name, err)
+	}
+	return mw, nil
+}
+
+// spokeIsClean reads the spoke-owned MaxUnavailable (see the IgnoreFields apply strategy
+// in reconcileSpokeManifestWork) back off the ManifestWork's status feedback. A spoke
+// that hasn't reported a value yet, or whose feedback couldn't be applied, is treated as
+// not-clean so the hub stays conservative.
+func spokeIsClean(mw *workv1.ManifestWork) bool {
+	for _, manifestStatus := range mw.Status.ResourceStatus.Manifests {
+		for _, value := range manifestStatus.StatusFeedbacks.Values {
+			if value.Name == spokeMaxUnavailableFeedback && value.Value.Integer != nil {
+				return *value.Value.Integer > 0
+			}
+		}
+	}
+	return false
+}
+
+// clusterWideMaxUnavailable mirrors the 0/1 flip the single-cluster fallback path uses.
+func clusterWideMaxUnavailable(isClean bool) int32 {
+	if isClean {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinedisruption
+
+import (
+	"testing"
+
+	workv1 "open-cluster-management.io/api/work/v1"
+)
+
+func feedbackManifestWork(name string, value *int64) *workv1.ManifestWork {
+	mw := &workv1.ManifestWork{
+		Status: workv1.ManifestWorkStatus{
+			ResourceStatus: workv1.ManifestResourceStatus{
+				Manifests: []workv1.ManifestCondition{
+					{
+						StatusFeedbacks: workv1.StatusFeedbackResult{},
+					},
+				},
+			},
+		},
+	}
+	if value != nil {
+		mw.Status.ResourceStatus.Manifests[0].StatusFeedbacks.Values = []workv1.FeedbackValue{
+			{Name: name, Value: workv1.FieldValue{Integer: value}},
+		}
+	}
+	return mw
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func TestSpokeIsClean(t *testing.T) {
+	if spokeIsClean(feedbackManifestWork(spokeMaxUnavailableFeedback, nil)) {
+		t.Error("expected a spoke with no reported feedback to not be clean")
+	}
+	if spokeIsClean(feedbackManifestWork(spokeMaxUnavailableFeedback, int64Ptr(0))) {
+		t.Error("expected a spoke reporting MaxUnavailable=0 to not be clean")
+	}
+	if !spokeIsClean(feedbackManifestWork(spokeMaxUnavailableFeedback, int64Ptr(1))) {
+		t.Error("expected a spoke reporting MaxUnavailable>0 to be clean")
+	}
+	if spokeIsClean(feedbackManifestWork("some-other-value", int64Ptr(1))) {
+		t.Error("expected an unrelated feedback value to be ignored")
+	}
+}
+
+func TestClusterWideMaxUnavailable(t *testing.T) {
+	if got := clusterWideMaxUnavailable(true); got != 1 {
+		t.Errorf("clusterWideMaxUnavailable(true) = %d, want 1", got)
+	}
+	if got := clusterWideMaxUnavailable(false); got != 0 {
+		t.Errorf("clusterWideMaxUnavailable(false) = %d, want 0", got)
+	}
+}
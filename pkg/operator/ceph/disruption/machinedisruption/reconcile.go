@@ -19,7 +19,6 @@ package machinedisruption
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/coreos/pkg/capnslog"
 	healthchecking "github.com/openshift/machine-api-operator/pkg/apis/healthchecking/v1alpha1"
@@ -47,9 +46,11 @@ var logger = capnslog.NewPackageLogger("github.com/rook/rook", controllerName)
 
 // MachineDisruptionReconciler reconciles MachineDisruption
 type MachineDisruptionReconciler struct {
-	scheme  *runtime.Scheme
-	client  client.Client
-	context *controllerconfig.Context
+	scheme               *runtime.Scheme
+	client               client.Client
+	context              *controllerconfig.Context
+	cleanCache           *clusterCleanCache
+	poolReplicationCache *poolReplicationCache
 }
 
 // Reconcile is the implementation of reconcile function for MachineDisruptionReconciler
@@ -74,21 +75,111 @@ func (r *MachineDisruptionReconciler) Reconcile(request reconcile.Request) (reco
 		return reconcile.Result{}, nil
 	}
 
+	// Stretch-mode clusters span multiple OCM-managed clusters rather than a single one;
+	// their budget is aggregated from each member cluster's own mons instead of read off
+	// this cluster's, so that path is handled entirely separately below.
+	if handled, err := r.reconcilePlacementMDB(cephClusterInstance, request); handled {
+		return reconcile.Result{}, err
+	}
+
+	// Check if the cluster is clean or not; gates every MDB below.
+	isClean, cached := r.cleanCache.Get(request.NamespacedName)
+	if !cached {
+		_, isClean, err = cephClient.IsClusterClean(r.context.ClusterdContext, request.Name)
+		if err != nil {
+			logger.Errorf("failed to get cephCluster status %+v", err)
+			return reconcile.Result{}, err
+		}
+		r.cleanCache.Set(request.NamespacedName, isClean)
+	}
+
+	domains, err := machinelabel.FailureDomains(r.context, &cephClient.ClusterInfo{Namespace: request.Namespace})
+	if err != nil {
+		// Topology couldn't be resolved. Fall back to a single, cluster-wide MDB rather
+		// than failing the reconcile outright.
+		logger.Warningf("could not resolve crush topology for %s, falling back to a single mdb: %+v", request.NamespacedName, err)
+		domains = nil
+	}
+
+	if len(domains) == 0 {
+		return reconcile.Result{}, r.reconcileClusterMDB(cephClusterInstance, request, isClean)
+	}
+
+	// The per-domain MDBs below select on MachineFailureDomainLabelKey, so the Machines in
+	// each domain must actually carry that label before those selectors can match anything.
+	if err := machinelabel.LabelFailureDomains(context.TODO(), r.client, domains); err != nil {
+		logger.Errorf("failed to label machines for %s: %+v", request.NamespacedName, err)
+		return reconcile.Result{}, err
+	}
+
+	// Fetched once per reconcile and cached the same way isClean is.
+	replication, replicationKnown := r.poolReplicationCache.Get(request.NamespacedName)
+	if !replicationKnown {
+		size, minSize, err := cephClient.GetPoolReplication(r.context.ClusterdContext, request.Name)
+		if err != nil {
+			logger.Errorf("failed to get pool replication for %s, defaulting every domain to maxUnavailable 0: %+v", request.NamespacedName, err)
+		} else {
+			replication = poolReplication{Size: size, MinSize: minSize}
+			r.poolReplicationCache.Set(request.NamespacedName, replication)
+			replicationKnown = true
+		}
+	}
+
+	for _, domain := range domains {
+		if err := r.reconcileDomainMDB(cephClusterInstance, request, domain, isClean, replication, replicationKnown); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	return reconcile.Result{}, nil
+}
+
+// reconcileClusterMDB creates or updates the single, cluster-wide MDB used as a fallback
+// when the CRUSH topology cannot be sharded into failure domains.
+func (r *MachineDisruptionReconciler) reconcileClusterMDB(cephClusterInstance *cephv1.CephCluster, request reconcile.Request, isClean bool) error {
+	name := generateMDBInstanceName(request.Name, request.Namespace)
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			machinelabel.MachineFencingLabelKey:          request.Name,
+			machinelabel.MachineFencingNamespaceLabelKey: request.Namespace,
+		},
+	}
+	return r.reconcileMDB(cephClusterInstance, request, name, selector, clusterWideMaxUnavailable(isClean))
+}
+
+// reconcileDomainMDB creates or updates the MDB scoped to a single CRUSH failure domain
+// bucket, sized from the pool's replication parameters (fetched once per reconcile by the
+// caller, not once per domain) rather than a flat 0/1.
+func (r *MachineDisruptionReconciler) reconcileDomainMDB(cephClusterInstance *cephv1.CephCluster, request reconcile.Request, domain machinelabel.FailureDomain, isClean bool, replication poolReplication, replicationKnown bool) error {
+	name := generateFailureDomainMDBInstanceName(request.Name, request.Namespace, domain.Name)
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			machinelabel.MachineFencingLabelKey:          request.Name,
+			machinelabel.MachineFencingNamespaceLabelKey: request.Namespace,
+			machinelabel.MachineFailureDomainLabelKey:    domain.Name,
+		},
+	}
+	maxUnavailable := int32(0)
+	if isClean && replicationKnown {
+		maxUnavailable = maxUnavailableForDomain(replication.Size, replication.MinSize, len(domain.Machines))
+	}
+	return r.reconcileMDB(cephClusterInstance, request, name, selector, maxUnavailable)
+}
+
+// reconcileMDB creates the named MDB if it doesn't exist, or brings an existing one's
+// MaxUnavailable in line with the desired state. An existing MDB's selector is left as is.
+func (r *MachineDisruptionReconciler) reconcileMDB(cephClusterInstance *cephv1.CephCluster, request reconcile.Request, name string, selector *metav1.LabelSelector, maxUnavailable int32) error {
 	mdb := &healthchecking.MachineDisruptionBudget{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      generateMDBInstanceName(request.Name, request.Namespace),
+			Name:      name,
 			Namespace: cephClusterInstance.Spec.DisruptionManagement.MachineDisruptionBudgetNamespace,
 		},
 	}
 
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: mdb.GetName(), Namespace: mdb.GetNamespace()}, mdb)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: mdb.GetName(), Namespace: mdb.GetNamespace()}, mdb)
 	if errors.IsNotFound(err) {
-		// If the MDB is not found creating the MDB for the cephCluster
-		maxUnavailable := int32(0)
-		// Generating the MDB instance for the cephCluster
 		newMDB := &healthchecking.MachineDisruptionBudget{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      generateMDBInstanceName(request.Name, request.Namespace),
+				Name:      name,
 				Namespace: cephClusterInstance.Spec.DisruptionManagement.MachineDisruptionBudgetNamespace,
 				Labels: map[string]string{
 					MDBCephClusterNamespaceLabelKey: request.Namespace,
@@ -98,61 +189,48 @@ func (r *MachineDisruptionReconciler) Reconcile(request reconcile.Request) (reco
 			},
 			Spec: healthchecking.MachineDisruptionBudgetSpec{
 				MaxUnavailable: &maxUnavailable,
-				Selector: &metav1.LabelSelector{
-					MatchLabels: map[string]string{
-						machinelabel.MachineFencingLabelKey:          request.Name,
-						machinelabel.MachineFencingNamespaceLabelKey: request.Namespace,
-					},
-				},
+				Selector:       selector,
 			},
 		}
-		err = r.client.Create(context.TODO(), newMDB)
-		if err != nil {
-			logger.Errorf("failed to create mdb %+v", err)
-			return reconcile.Result{}, err
+		if err := r.client.Create(context.TODO(), newMDB); err != nil {
+			logger.Errorf("failed to create mdb %s: %+v", name, err)
+			return err
 		}
-		return reconcile.Result{}, nil
+		return nil
 	} else if err != nil {
 		logger.Errorf("%+v", err)
-		return reconcile.Result{}, err
-	}
-	if mdb.Spec.MaxUnavailable == nil {
-		maxUnavailable := int32(0)
-		mdb.Spec.MaxUnavailable = &maxUnavailable
+		return err
 	}
-	// Check if the cluster is clean or not
-	_, isClean, err := cephClient.IsClusterClean(r.context.ClusterdContext, request.Name)
-	if err != nil {
-		logger.Errorf("failed to get cephCluster status %+v", err)
-		maxUnavailable := int32(0)
+
+	if mdb.Spec.MaxUnavailable == nil || *mdb.Spec.MaxUnavailable != maxUnavailable {
 		mdb.Spec.MaxUnavailable = &maxUnavailable
-		updateErr := r.client.Update(context.TODO(), mdb)
-		if err != nil {
-			logger.Errorf("failed to update mdb %+v", err)
-			return reconcile.Result{}, updateErr
+		if err := r.client.Update(context.TODO(), mdb); err != nil {
+			logger.Errorf("failed to update mdb %s: %+v", name, err)
+			return err
 		}
-		return reconcile.Result{}, err
 	}
-	if isClean && *mdb.Spec.MaxUnavailable != 1 {
-		maxUnavailable := int32(1)
-		mdb.Spec.MaxUnavailable = &maxUnavailable
-		err = r.client.Update(context.TODO(), mdb)
-		if err != nil {
-			logger.Errorf("failed to update mdb %+v", err)
-			return reconcile.Result{}, err
-		}
-	} else if !isClean && *mdb.Spec.MaxUnavailable != 0 {
-		maxUnavailable := int32(0)
-		mdb.Spec.MaxUnavailable = &maxUnavailable
-		err = r.client.Update(context.TODO(), mdb)
-		if err != nil {
-			logger.Errorf("failed to update mdb %+v", err)
-			return reconcile.Result{}, err
-		}
+	return nil
+}
+
+// maxUnavailableForDomain sizes a failure domain's budget from the pool's replication
+// factor: losing up to size-minSize replicas still leaves the pool serviceable. The result
+// is further clamped to the number of machines actually present in the domain, since a
+// budget can never exceed the population it's drawn from.
+func maxUnavailableForDomain(size, minSize, machineCount int) int32 {
+	allowed := size - minSize
+	if allowed < 0 {
+		allowed = 0
 	}
-	return reconcile.Result{Requeue: true, RequeueAfter: time.Minute}, nil
+	if allowed > machineCount {
+		allowed = machineCount
+	}
+	return int32(allowed)
 }
 
 func generateMDBInstanceName(name, namespace string) string {
 	return fmt.Sprintf("%s-%s", name, namespace)
 }
+
+func generateFailureDomainMDBInstanceName(name, namespace, domain string) string {
+	return fmt.Sprintf("%s-%s-%s", name, namespace, domain)
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinedisruption
+
+import "testing"
+
+func TestMaxUnavailableForDomain(t *testing.T) {
+	cases := []struct {
+		name         string
+		size         int
+		minSize      int
+		machineCount int
+		want         int32
+	}{
+		{"healthy 3/2 pool, plenty of machines", 3, 2, 3, 1},
+		{"size equals min_size, nothing to spare", 3, 3, 3, 0},
+		{"min_size greater than size never goes negative", 2, 3, 3, 0},
+		{"clamped to the domain's machine population", 5, 2, 1, 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := maxUnavailableForDomain(c.size, c.minSize, c.machineCount)
+			if got != c.want {
+				t.Errorf("maxUnavailableForDomain(%d, %d, %d) = %d, want %d", c.size, c.minSize, c.machineCount, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinedisruption
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/coreos/pkg/capnslog"
+	machineapi "github.com/openshift/machine-api-operator/pkg/apis/machine/v1beta1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	cephClient "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/disruption/controllerconfig"
+	"github.com/rook/rook/pkg/operator/ceph/disruption/machinelabel"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+)
+
+const (
+	// machineDeleteWebhookPath is the path the webhook is served on.
+	machineDeleteWebhookPath = "/validate-machine-deletion"
+
+	// forceMachineDeleteAnnotation lets an operator bypass the live health check for a
+	// single Machine.
+	forceMachineDeleteAnnotation = "rook.io/force-machine-delete"
+
+	// webhookConfigurationName is the name of the ValidatingWebhookConfiguration.
+	webhookConfigurationName = "rook-ceph-machine-disruption"
+
+	// webhookServiceName is the Service fronting the operator's webhook port.
+	webhookServiceName = "rook-ceph-operator-webhook"
+)
+
+var webhookLogger = capnslog.NewPackageLogger("github.com/rook/rook", "machinedisruption-webhook")
+
+// MachineDeletionValidator denies deletion of a Machine hosting Ceph OSDs that would
+// breach the affected pools' min_size.
+type MachineDeletionValidator struct {
+	client  client.Client
+	context *controllerconfig.Context
+	decoder *admission.Decoder
+}
+
+// Handle implements admission.Handler.
+func (v *MachineDeletionValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	machine := &machineapi.Machine{}
+	if err := v.decoder.DecodeRaw(req.OldObject, machine); err != nil {
+		webhookLogger.Errorf("failed to decode machine %s for admission: %+v", req.Name, err)
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	isDeletion := req.Operation == "DELETE"
+	if req.Operation == "UPDATE" && machine.DeletionTimestamp == nil {
+		newMachine := &machineapi.Machine{}
+		if err := v.decoder.Decode(req, newMachine); err != nil {
+			webhookLogger.Errorf("failed to decode machine %s for admission: %+v", req.Name, err)
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		isDeletion = newMachine.DeletionTimestamp != nil
+	}
+	if !isDeletion {
+		return admission.Allowed("not a deletion")
+	}
+
+	if machine.Annotations[forceMachineDeleteAnnotation] == "true" {
+		webhookLogger.Infof("allowing deletion of machine %s: %s annotation present", machine.Name, forceMachineDeleteAnnotation)
+		return admission.Allowed("force-delete annotation present")
+	}
+
+	clusterName, clusterNamespace, ok := fencedCluster(machine)
+	if !ok {
+		// Machine isn't fenced to a rook CephCluster; nothing for us to protect.
+		return admission.Allowed("machine is not fenced to a CephCluster")
+	}
+
+	if machine.Status.NodeRef == nil {
+		return admission.Allowed("machine has no backing node")
+	}
+	nodeName := machine.Status.NodeRef.Name
+
+	osdIDs, err := cephClient.GetOSDsOnNode(v.context.ClusterdContext, clusterName, nodeName)
+	if err != nil {
+		webhookLogger.Errorf("failed to list osds on node %s: %+v", nodeName, err)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if len(osdIDs) == 0 {
+		return admission.Allowed("node hosts no osds")
+	}
+
+	_, isClean, err := cephClient.IsClusterClean(v.context.ClusterdContext, clusterName)
+	if err != nil {
+		webhookLogger.Errorf("failed to get cluster health for %s: %+v", clusterNamespace, err)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !isClean {
+		return admission.Denied(fmt.Sprintf("cephCluster %s/%s is not clean; refusing to delete machine %s which hosts osds %v",
+			clusterNamespace, clusterName, machine.Name, osdIDs))
+	}
+
+	for _, osdID := range osdIDs {
+		okToStop, err := cephClient.OSDOkToStop(v.context.ClusterdContext, clusterName, osdID)
+		if err != nil {
+			webhookLogger.Errorf("failed to check ok-to-stop for osd.%d: %+v", osdID, err)
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if !okToStop {
+			return admission.Denied(fmt.Sprintf("osd.%d on machine %s is not ok-to-stop; deleting this machine would breach min_size", osdID, machine.Name))
+		}
+	}
+
+	return admission.Allowed("cluster is clean and all osds on the machine are ok-to-stop")
+}
+
+// InjectDecoder implements admission.DecoderInjector.
+func (v *MachineDeletionValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+func fencedCluster(machine *machineapi.Machine) (name, namespace string, ok bool) {
+	name, ok = machine.Labels[machinelabel.MachineFencingLabelKey]
+	if !ok {
+		return "", "", false
+	}
+	namespace, ok = machine.Labels[machinelabel.MachineFencingNamespaceLabelKey]
+	return name, namespace, ok
+}
+
+// AddWebhook registers MachineDeletionValidator with the manager's webhook server and
+// ensures its ValidatingWebhookConfiguration exists.
+func AddWebhook(mgr manager.Manager, context *controllerconfig.Context) error {
+	mgr.GetWebhookServer().Register(machineDeleteWebhookPath, &webhook.Admission{
+		Handler: &MachineDeletionValidator{
+			client:  mgr.GetClient(),
+			context: context,
+		},
+	})
+
+	operatorNamespace := k8sutil.GetOperatorNamespace()
+	if err := ensureValidatingWebhookConfiguration(context, operatorNamespace); err != nil {
+		return fmt.Errorf("failed to ensure validatingwebhookconfiguration %s: %+v", webhookConfigurationName, err)
+	}
+	return nil
+}
+
+// ensureValidatingWebhookConfiguration creates, or updates in place, the
+// ValidatingWebhookConfiguration routing Machine delete admission requests to this webhook.
+func ensureValidatingWebhookConfiguration(clusterdContext *controllerconfig.Context, operatorNamespace string) error {
+	path := machineDeleteWebhookPath
+	failurePolicy := admissionregistrationv1.Fail
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	scope := admissionregistrationv1.AllScopes
+
+	config := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: webhookConfigurationName,
+		},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{
+			{
+				Name: "machine-deletion.rook.io",
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{
+					Service: &admissionregistrationv1.ServiceReference{
+						Name:      webhookServiceName,
+						Namespace: operatorNamespace,
+						Path:      &path,
+					},
+				},
+				Rules: []admissionregistrationv1.RuleWithOperations{
+					{
+						Operations: []admissionregistrationv1.OperationType{
+							admissionregistrationv1.Delete,
+							admissionregistrationv1.Update,
+						},
+						Rule: admissionregistrationv1.Rule{
+							APIGroups:   []string{machineapi.SchemeGroupVersion.Group},
+							APIVersions: []string{machineapi.SchemeGroupVersion.Version},
+							Resources:   []string{"machines"},
+							Scope:       &scope,
+						},
+					},
+				},
+				// Only Machines this feature fences are in scope; an operator outage with
+				// FailurePolicy: Fail must not block deletion of every other Machine.
+				ObjectSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: machinelabel.MachineFencingLabelKey, Operator: metav1.LabelSelectorOpExists},
+					},
+				},
+				FailurePolicy:           &failurePolicy,
+				SideEffects:             &sideEffects,
+				AdmissionReviewVersions: []string{"v1"},
+			},
+		},
+	}
+
+	webhookConfigs := clusterdContext.ClusterdContext.Clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+
+	_, err := webhookConfigs.Create(context.TODO(), config, metav1.CreateOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing, err := webhookConfigs.Get(context.TODO(), webhookConfigurationName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get existing validatingwebhookconfiguration: %+v", err)
+	}
+	config.ResourceVersion = existing.ResourceVersion
+	_, err = webhookConfigs.Update(context.TODO(), config, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinedisruption
+
+import (
+	"testing"
+
+	machineapi "github.com/openshift/machine-api-operator/pkg/apis/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/rook/rook/pkg/operator/ceph/disruption/machinelabel"
+)
+
+func TestFencedCluster(t *testing.T) {
+	unfenced := &machineapi.Machine{}
+	if _, _, ok := fencedCluster(unfenced); ok {
+		t.Error("expected a machine with no fencing labels to not be fenced")
+	}
+
+	missingNamespace := &machineapi.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				machinelabel.MachineFencingLabelKey: "my-cluster",
+			},
+		},
+	}
+	if _, _, ok := fencedCluster(missingNamespace); ok {
+		t.Error("expected a machine missing the namespace label to not be fenced")
+	}
+
+	fenced := &machineapi.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				machinelabel.MachineFencingLabelKey:          "my-cluster",
+				machinelabel.MachineFencingNamespaceLabelKey: "rook-ceph",
+			},
+		},
+	}
+	name, namespace, ok := fencedCluster(fenced)
+	if !ok || name != "my-cluster" || namespace != "rook-ceph" {
+		t.Errorf("fencedCluster(fenced) = %q, %q, %v; want my-cluster, rook-ceph, true", name, namespace, ok)
+	}
+}
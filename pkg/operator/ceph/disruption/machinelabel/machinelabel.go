@@ -0,0 +1,145 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package machinelabel defines the labels that fence Machines hosting Ceph OSDs: the
+// CephCluster they belong to, and (when the CRUSH topology allows it) the failure domain
+// bucket their OSDs are placed in. MachineDisruptionBudgets select on these labels. Of
+// these, the package itself applies only the failure domain label (LabelFailureDomains).
+package machinelabel
+
+import (
+	"context"
+	"fmt"
+
+	machineapi "github.com/openshift/machine-api-operator/pkg/apis/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cephClient "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/disruption/controllerconfig"
+)
+
+const (
+	// MachineFencingLabelKey is the key of the label added to a Machine to associate it
+	// with the name of the CephCluster whose OSDs it may host.
+	MachineFencingLabelKey = "rook.io/machine-fenced"
+	// MachineFencingNamespaceLabelKey is the key of the label identifying the namespace of
+	// the CephCluster that fenced a Machine.
+	MachineFencingNamespaceLabelKey = "rook.io/machine-fenced-namespace"
+	// MachineFailureDomainLabelKey is the key of the label recording the CRUSH failure
+	// domain bucket (e.g. a rack or zone) a fenced Machine's OSDs fall under.
+	MachineFailureDomainLabelKey = "rook.io/machine-failure-domain"
+
+	// machineNamespace is the fixed namespace the machine-api-operator runs Machines in.
+	machineNamespace = "openshift-machine-api"
+)
+
+// FailureDomain is one CRUSH bucket, at the level used by the cluster's pools for their
+// failure domain (e.g. "rack" or "zone"), together with the Machines backing the OSDs
+// placed in that bucket.
+type FailureDomain struct {
+	// Name is the CRUSH bucket name, e.g. "rack1".
+	Name string
+	// Machines are the names of the Machines hosting an OSD in this bucket.
+	Machines []string
+}
+
+// FailureDomains enumerates the CRUSH map for the named CephCluster and groups the
+// Machines hosting its OSDs by failure domain bucket. Returns no domains, not an error,
+// when the CRUSH map has no failure domain type or none of its OSDs resolve to a Machine;
+// returns an error only when the CRUSH map can't be fetched.
+func FailureDomains(clusterdContext *controllerconfig.Context, clusterInfo *cephClient.ClusterInfo) ([]FailureDomain, error) {
+	crushMap, err := cephClient.GetCrushMap(clusterdContext.ClusterdContext, clusterInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get crush map for cluster %s: %+v", clusterInfo.Namespace, err)
+	}
+
+	domainType := crushMap.FailureDomainType()
+	if domainType == "" {
+		return nil, nil
+	}
+
+	var assignments []machineDomainAssignment
+	for _, osd := range crushMap.OSDs() {
+		bucketName, ok := osd.Ancestor(domainType)
+		if !ok {
+			continue
+		}
+		machineName, ok := clusterdContext.MachineForNode(osd.NodeName)
+		if !ok {
+			continue
+		}
+		assignments = append(assignments, machineDomainAssignment{Domain: bucketName, Machine: machineName})
+	}
+	return groupMachinesByDomain(assignments), nil
+}
+
+// machineDomainAssignment is one Machine's resolved failure domain bucket.
+type machineDomainAssignment struct {
+	Domain  string
+	Machine string
+}
+
+// groupMachinesByDomain collects assignments into one FailureDomain per distinct bucket.
+func groupMachinesByDomain(assignments []machineDomainAssignment) []FailureDomain {
+	buckets := map[string][]string{}
+	for _, a := range assignments {
+		buckets[a.Domain] = appendUnique(buckets[a.Domain], a.Machine)
+	}
+
+	domains := make([]FailureDomain, 0, len(buckets))
+	for name, machines := range buckets {
+		domains = append(domains, FailureDomain{Name: name, Machines: machines})
+	}
+	return domains
+}
+
+// LabelFailureDomains stamps every Machine in each domain with MachineFailureDomainLabelKey.
+// Returns on the first error; the caller's own reconcile retry will pick up the rest.
+func LabelFailureDomains(ctx context.Context, c client.Client, domains []FailureDomain) error {
+	for _, domain := range domains {
+		for _, machineName := range domain.Machines {
+			if err := labelMachine(ctx, c, machineName, domain.Name); err != nil {
+				return fmt.Errorf("failed to label machine %s with failure domain %s: %+v", machineName, domain.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func labelMachine(ctx context.Context, c client.Client, machineName, domainName string) error {
+	machine := &machineapi.Machine{}
+	if err := c.Get(ctx, types.NamespacedName{Name: machineName, Namespace: machineNamespace}, machine); err != nil {
+		return err
+	}
+	if machine.Labels[MachineFailureDomainLabelKey] == domainName {
+		return nil
+	}
+	if machine.Labels == nil {
+		machine.Labels = map[string]string{}
+	}
+	machine.Labels[MachineFailureDomainLabelKey] = domainName
+	return c.Update(ctx, machine)
+}
+
+func appendUnique(machines []string, machine string) []string {
+	for _, m := range machines {
+		if m == machine {
+			return machines
+		}
+	}
+	return append(machines, machine)
+}
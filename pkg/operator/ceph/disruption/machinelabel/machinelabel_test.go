@@ -0,0 +1,102 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinelabel
+
+import (
+	"context"
+	"testing"
+
+	machineapi "github.com/openshift/machine-api-operator/pkg/apis/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAppendUnique(t *testing.T) {
+	machines := appendUnique(nil, "machine-a")
+	machines = appendUnique(machines, "machine-b")
+	machines = appendUnique(machines, "machine-a")
+
+	if len(machines) != 2 {
+		t.Fatalf("expected 2 unique machines, got %d: %v", len(machines), machines)
+	}
+	if machines[0] != "machine-a" || machines[1] != "machine-b" {
+		t.Fatalf("unexpected machine order: %v", machines)
+	}
+}
+
+func TestGroupMachinesByDomain(t *testing.T) {
+	domains := groupMachinesByDomain([]machineDomainAssignment{
+		{Domain: "rack1", Machine: "machine-a"},
+		{Domain: "rack1", Machine: "machine-b"},
+		{Domain: "rack2", Machine: "machine-c"},
+		{Domain: "rack1", Machine: "machine-a"},
+	})
+
+	byName := map[string][]string{}
+	for _, d := range domains {
+		byName[d.Name] = d.Machines
+	}
+
+	if len(domains) != 2 {
+		t.Fatalf("expected 2 domains, got %d: %+v", len(domains), domains)
+	}
+	if machines := byName["rack1"]; len(machines) != 2 {
+		t.Errorf("expected rack1 to have 2 unique machines, got %v", machines)
+	}
+	if machines := byName["rack2"]; len(machines) != 1 || machines[0] != "machine-c" {
+		t.Errorf("expected rack2 to have [machine-c], got %v", machines)
+	}
+}
+
+func newFakeMachineClient(t *testing.T, objs ...runtime.Object) client.Client {
+	scheme := runtime.NewScheme()
+	if err := machineapi.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to register machine-api scheme: %+v", err)
+	}
+	return fake.NewFakeClientWithScheme(scheme, objs...)
+}
+
+func TestLabelFailureDomains(t *testing.T) {
+	existing := &machineapi.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "machine-a", Namespace: machineNamespace},
+	}
+	c := newFakeMachineClient(t, existing)
+
+	domains := []FailureDomain{{Name: "rack1", Machines: []string{"machine-a"}}}
+	if err := LabelFailureDomains(context.TODO(), c, domains); err != nil {
+		t.Fatalf("LabelFailureDomains returned an error: %+v", err)
+	}
+
+	got := &machineapi.Machine{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Name: "machine-a", Namespace: machineNamespace}, got); err != nil {
+		t.Fatalf("failed to fetch machine after labeling: %+v", err)
+	}
+	if got.Labels[MachineFailureDomainLabelKey] != "rack1" {
+		t.Errorf("expected machine-a to be labeled rack1, got labels %v", got.Labels)
+	}
+}
+
+func TestLabelFailureDomainsMissingMachine(t *testing.T) {
+	c := newFakeMachineClient(t)
+	domains := []FailureDomain{{Name: "rack1", Machines: []string{"does-not-exist"}}}
+	if err := LabelFailureDomains(context.TODO(), c, domains); err == nil {
+		t.Fatal("expected an error labeling a Machine that doesn't exist")
+	}
+}